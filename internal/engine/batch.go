@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+)
+
+type batchOp struct {
+	op    byte
+	key   string
+	value string
+}
+
+// Batch accumulates Set/Delete operations in memory and applies them to
+// a Store as a single group, locking only the shards the batch actually
+// touches (in a fixed ascending order, same as Clear). This mirrors the
+// batch APIs in goleveldb and tendermint's db package, and is the right
+// tool whenever a caller needs to insert or remove many keys at once: it
+// pays the locking overhead once instead of once per key, and every
+// reader of an affected shard sees either all of the batch's writes to
+// that shard or none of them.
+//
+// A Batch is not safe for concurrent use.
+type Batch struct {
+	store *Store
+	ops   []batchOp
+}
+
+// NewBatch returns a Batch bound to s.
+func (s *Store) NewBatch() *Batch {
+	return &Batch{store: s}
+}
+
+// Set stages a key-value write to be applied by Write or WriteSync.
+func (b *Batch) Set(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("key cannot be empty")
+	}
+	b.ops = append(b.ops, batchOp{op: opSet, key: b.store.keyFor(key), value: value})
+	return nil
+}
+
+// Delete stages a key removal to be applied by Write or WriteSync.
+func (b *Batch) Delete(key string) error {
+	b.ops = append(b.ops, batchOp{op: opDelete, key: b.store.keyFor(key)})
+	return nil
+}
+
+// Write applies every staged operation atomically with respect to
+// concurrent readers and writers of the store. If the store is
+// persistent, each operation is appended to the WAL, but the WAL is
+// only fsynced afterward if the store's Options.SyncWrites is set.
+func (b *Batch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync applies every staged operation, additionally fsyncing the
+// WAL once after the whole group has been appended (rather than once
+// per operation), before returning.
+func (b *Batch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *Batch) write(sync bool) error {
+	s := b.store
+
+	// Every op's WAL record is encoded and written as a single buffer
+	// before any shard is touched. Encoding a record can't fail, so the
+	// only failure mode left is the write itself, and that either lands
+	// in full or not at all - unlike appending one record per op, which
+	// would leave ops 1..k-1 durable and applied while op k and the rest
+	// of the group never happened. Shard mutations only start once this
+	// has returned successfully, so a batch is never partially applied.
+	if err := s.appendWALBatch(b.ops); err != nil {
+		return err
+	}
+
+	touched := make(map[*shard]struct{}, len(b.ops))
+	for _, op := range b.ops {
+		touched[s.shardFor(op.key)] = struct{}{}
+	}
+	shards := make([]*shard, 0, len(touched))
+	for sh := range touched {
+		shards = append(shards, sh)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].index < shards[j].index })
+
+	unlock := lockShardsAscending(shards)
+	// Results are kept per op, not per key, so a key that appears more
+	// than once in the batch gets bookkeeping for each of its ops.
+	existedAt := make([]bool, len(b.ops))
+	deletedAt := make([]bool, len(b.ops))
+	for i, op := range b.ops {
+		sh := s.shardFor(op.key)
+		switch op.op {
+		case opSet:
+			existedAt[i] = !sh.data.Set(op.key, entry{value: op.value})
+		case opDelete:
+			deletedAt[i] = sh.data.Delete(op.key)
+		}
+	}
+	unlock()
+
+	// Eviction bookkeeping happens after the shards are unlocked, same
+	// as every other mutating method, since the policy's own lock isn't
+	// one of the shard locks. A large batch may transiently push the
+	// store over MaxEntries until evictForInsert below catches up.
+	if s.opts.Policy != nil {
+		for i, op := range b.ops {
+			switch op.op {
+			case opSet:
+				s.recordSet(op.key, existedAt[i])
+			case opDelete:
+				// Only adjust bookkeeping for a delete that actually
+				// removed something, same as the non-batch Delete:
+				// recordDelete is unconditional, so calling it for a
+				// no-op delete of an absent key would drive entryCount
+				// negative and stop MaxEntries from ever being enforced
+				// again.
+				if deletedAt[i] {
+					s.recordDelete(op.key)
+				}
+			}
+		}
+		s.evictForInsert()
+	}
+
+	if !s.persistent {
+		return nil
+	}
+	if sync || s.opts.SyncWrites {
+		s.walMu.Lock()
+		err := s.wal.Sync()
+		s.walMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("engine: sync wal: %w", err)
+		}
+	}
+	s.maybeCheckpoint()
+	return nil
+}
+
+// Close discards any staged operations that haven't been written.
+func (b *Batch) Close() {
+	b.ops = nil
+}
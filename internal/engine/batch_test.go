@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBatchSetAndWrite(t *testing.T) {
+	store := NewStore()
+	batch := store.NewBatch()
+	defer batch.Close()
+
+	batch.Set("a", "1")
+	batch.Set("b", "2")
+	batch.Delete("a")
+
+	if store.Size() != 0 {
+		t.Fatalf("store should be untouched before Write, size = %d", store.Size())
+	}
+
+	if err := batch.Write(); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if v, ok := store.Get("b"); !ok || v != "2" {
+		t.Errorf("Get(b) = %q, %v, want 2, true", v, ok)
+	}
+	if _, ok := store.Get("a"); ok {
+		t.Error("a should have been deleted by the batch")
+	}
+}
+
+func TestBatchWriteIsAtomicOnWALFailure(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewPersistentStore(dir, Options{})
+	if err != nil {
+		t.Fatalf("NewPersistentStore failed: %v", err)
+	}
+	defer store.Close()
+
+	store.Set("existing", "0")
+
+	// Close the WAL file out from under the store, so the batch's WAL
+	// write fails partway through nothing - it should fail up front,
+	// before any shard is touched.
+	store.wal.Close()
+
+	batch := store.NewBatch()
+	defer batch.Close()
+	batch.Set("a", "1")
+	batch.Set("b", "2")
+	batch.Delete("existing")
+
+	if err := batch.Write(); err == nil {
+		t.Fatal("Write should fail once the WAL file is closed")
+	}
+
+	if store.Size() != 1 {
+		t.Errorf("Size() = %d, want 1 (a failed batch must apply none of its ops)", store.Size())
+	}
+	if !store.Exists("existing") {
+		t.Error("existing should not have been deleted by a batch that failed to write its WAL record")
+	}
+	if store.Exists("a") || store.Exists("b") {
+		t.Error("a and b should not have been set by a batch that failed to write its WAL record")
+	}
+}
+
+func TestBatchDeleteOfAbsentKeyDoesNotUnderflowEntryCount(t *testing.T) {
+	store := NewStoreWithOptions(Options{MaxEntries: 2, Policy: NewLRUPolicy()})
+	defer store.Close()
+
+	batch := store.NewBatch()
+	defer batch.Close()
+	batch.Delete("never-set-1")
+	batch.Delete("never-set-2")
+	batch.Delete("never-set-3")
+	if err := batch.Write(); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// If the ghost deletes above had driven entryCount negative,
+	// MaxEntries would never be enforced again: evictForInsert's loop
+	// condition (entryCount >= MaxEntries) would never trip.
+	store.Set("a", "1")
+	store.Set("b", "2")
+	store.Set("c", "3") // should evict a, not silently exceed MaxEntries
+
+	if store.Size() != 2 {
+		t.Errorf("Size() = %d, want 2 (ghost deletes should not have broken eviction)", store.Size())
+	}
+}
+
+func TestBatchSetEmptyKey(t *testing.T) {
+	batch := NewStore().NewBatch()
+	if err := batch.Set("", "value"); err == nil {
+		t.Error("Set with empty key should return an error")
+	}
+}
+
+func TestBatchWriteSyncPersists(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewPersistentStore(dir, Options{})
+	if err != nil {
+		t.Fatalf("NewPersistentStore failed: %v", err)
+	}
+	defer store.Close()
+
+	batch := store.NewBatch()
+	for i := 0; i < 10; i++ {
+		batch.Set(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i))
+	}
+	if err := batch.WriteSync(); err != nil {
+		t.Fatalf("WriteSync failed: %v", err)
+	}
+
+	reopened, err := NewPersistentStore(dir, Options{})
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer reopened.Close()
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		want := fmt.Sprintf("value-%d", i)
+		if v, ok := reopened.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %q, %v, want %q, true", key, v, ok, want)
+		}
+	}
+}
+
+// BenchmarkBatchWrite and BenchmarkLoopOverSet compare the same
+// workload (100 Set calls against a shared, non-persistent store, under
+// concurrent callers via RunParallel) applied as one Batch versus as
+// individual Set calls. Batch.Write's per-call overhead (building and
+// sorting the touched shard set, then locking every one of them up
+// front) is real, and measured here it outweighs the savings from
+// acquiring each shard's lock once per group instead of once per key.
+// On a plain in-memory store, Batch's real selling point is atomicity
+// across a group of writes, not raw throughput - see
+// BenchmarkBatchWriteSync below for the persistent-store workload
+// where batching does win on throughput, by amortizing fsync.
+func BenchmarkBatchWrite(b *testing.B) {
+	store := NewStore()
+	defer store.Close()
+	keys := make([]string, 100)
+	for j := range keys {
+		keys[j] = fmt.Sprintf("key-%d", j)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			batch := store.NewBatch()
+			for _, k := range keys {
+				batch.Set(k, "value")
+			}
+			batch.Write()
+			batch.Close()
+		}
+	})
+}
+
+func BenchmarkLoopOverSet(b *testing.B) {
+	store := NewStore()
+	defer store.Close()
+	keys := make([]string, 100)
+	for j := range keys {
+		keys[j] = fmt.Sprintf("key-%d", j)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for _, k := range keys {
+				store.Set(k, "value")
+			}
+		}
+	})
+}
+
+// BenchmarkBatchWriteSync and BenchmarkLoopOverSetSync are where
+// batching's throughput win actually shows up: on a persistent store
+// with SyncWrites, every individual Set fsyncs the WAL on its own,
+// while a Batch's WriteSync fsyncs exactly once for the whole group.
+// fsync, not shard locking, dominates the cost of a single Set here.
+func BenchmarkBatchWriteSync(b *testing.B) {
+	store, err := NewPersistentStore(b.TempDir(), Options{SyncWrites: true})
+	if err != nil {
+		b.Fatalf("NewPersistentStore failed: %v", err)
+	}
+	defer store.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch := store.NewBatch()
+		for j := 0; j < 100; j++ {
+			batch.Set(fmt.Sprintf("key-%d-%d", i, j), "value")
+		}
+		if err := batch.WriteSync(); err != nil {
+			b.Fatalf("WriteSync failed: %v", err)
+		}
+		batch.Close()
+	}
+}
+
+func BenchmarkLoopOverSetSync(b *testing.B) {
+	store, err := NewPersistentStore(b.TempDir(), Options{SyncWrites: true})
+	if err != nil {
+		b.Fatalf("NewPersistentStore failed: %v", err)
+	}
+	defer store.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			if err := store.Set(fmt.Sprintf("key-%d-%d", i, j), "value"); err != nil {
+				b.Fatalf("Set failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package engine
+
+import "fmt"
+
+// Reader is the read side of the engine's key-value contract.
+type Reader interface {
+	Get(key string) (string, bool)
+	Exists(key string) bool
+}
+
+// Writer is the write side of the engine's key-value contract.
+type Writer interface {
+	Set(key, value string) error
+	Delete(key string) bool
+}
+
+// ReadWriter is satisfied by both *Store and *CacheStore, which is what
+// lets a CacheStore wrap either one transparently.
+type ReadWriter interface {
+	Reader
+	Writer
+}
+
+// CacheStore is an in-memory overlay over a ReadWriter, following the
+// CacheDB pattern from tendermint: Set/Delete are buffered locally and
+// only applied to the parent once Write is called, while Get/Exists
+// read through to the parent for keys the overlay hasn't touched. This
+// gives callers speculative, try-then-commit semantics on top of the
+// engine without needing a real transaction log.
+//
+// Because CacheStore itself implements ReadWriter, it can be wrapped
+// again, so callers can stack several layers of staged changes.
+//
+// A CacheStore is not safe for concurrent use.
+type CacheStore struct {
+	parent  ReadWriter
+	cache   map[string]string
+	deleted map[string]struct{}
+}
+
+// CacheWrap returns a CacheStore overlaying s.
+func (s *Store) CacheWrap() *CacheStore {
+	return newCacheStore(s)
+}
+
+// CacheWrap returns a CacheStore overlaying c, allowing cache wraps to
+// nest.
+func (c *CacheStore) CacheWrap() *CacheStore {
+	return newCacheStore(c)
+}
+
+func newCacheStore(parent ReadWriter) *CacheStore {
+	return &CacheStore{
+		parent:  parent,
+		cache:   make(map[string]string),
+		deleted: make(map[string]struct{}),
+	}
+}
+
+// Set buffers a key-value write; it is not visible to the parent until
+// Write is called.
+func (c *CacheStore) Set(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("key cannot be empty")
+	}
+	delete(c.deleted, key)
+	c.cache[key] = value
+	return nil
+}
+
+// Delete buffers a key removal, reporting whether the key existed in
+// the overlay's current view (local cache, or the parent if untouched
+// locally). The parent itself is not modified until Write is called.
+func (c *CacheStore) Delete(key string) bool {
+	_, existed := c.Get(key)
+	delete(c.cache, key)
+	c.deleted[key] = struct{}{}
+	return existed
+}
+
+// Get returns the overlay's current view of key: the locally buffered
+// value if Set was called, "not found" if Delete was called, or
+// otherwise the parent's value.
+func (c *CacheStore) Get(key string) (string, bool) {
+	if _, ok := c.deleted[key]; ok {
+		return "", false
+	}
+	if v, ok := c.cache[key]; ok {
+		return v, true
+	}
+	return c.parent.Get(key)
+}
+
+// Exists reports whether key is present in the overlay's current view.
+func (c *CacheStore) Exists(key string) bool {
+	_, ok := c.Get(key)
+	return ok
+}
+
+// Write flushes every buffered mutation into the parent atomically with
+// respect to the parent's own readers and writers, then clears the
+// overlay so it can be reused.
+func (c *CacheStore) Write() error {
+	if store, ok := c.parent.(*Store); ok {
+		batch := store.NewBatch()
+		defer batch.Close()
+		for k, v := range c.cache {
+			if err := batch.Set(k, v); err != nil {
+				return err
+			}
+		}
+		for k := range c.deleted {
+			if err := batch.Delete(k); err != nil {
+				return err
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+	} else {
+		for k, v := range c.cache {
+			if err := c.parent.Set(k, v); err != nil {
+				return err
+			}
+		}
+		for k := range c.deleted {
+			c.parent.Delete(k)
+		}
+	}
+
+	c.reset()
+	return nil
+}
+
+// Discard drops every buffered mutation without applying it to the
+// parent.
+func (c *CacheStore) Discard() {
+	c.reset()
+}
+
+func (c *CacheStore) reset() {
+	c.cache = make(map[string]string)
+	c.deleted = make(map[string]struct{})
+}
@@ -0,0 +1,97 @@
+package engine
+
+import "testing"
+
+func TestCacheStoreIsolationUntilWrite(t *testing.T) {
+	store := NewStore()
+	store.Set("a", "1")
+
+	cache := store.CacheWrap()
+	cache.Set("a", "2")
+	cache.Set("b", "3")
+
+	if v, _ := store.Get("a"); v != "1" {
+		t.Errorf("parent should be unchanged before Write, got a=%q", v)
+	}
+	if store.Exists("b") {
+		t.Error("parent should not see 'b' before Write")
+	}
+
+	if err := cache.Write(); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if v, _ := store.Get("a"); v != "2" {
+		t.Errorf("parent a = %q after Write, want 2", v)
+	}
+	if v, ok := store.Get("b"); !ok || v != "3" {
+		t.Errorf("parent b = %q, %v after Write, want 3, true", v, ok)
+	}
+}
+
+func TestCacheStoreDiscard(t *testing.T) {
+	store := NewStore()
+	store.Set("a", "1")
+
+	cache := store.CacheWrap()
+	cache.Set("a", "2")
+	cache.Delete("a")
+	cache.Discard()
+
+	if v, _ := store.Get("a"); v != "1" {
+		t.Errorf("parent should be unchanged after Discard, got a=%q", v)
+	}
+}
+
+func TestCacheStoreTombstoneReadThrough(t *testing.T) {
+	store := NewStore()
+	store.Set("a", "1")
+
+	cache := store.CacheWrap()
+	if existed := cache.Delete("a"); !existed {
+		t.Error("Delete should report the parent's key as existing")
+	}
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("deleted key should not be visible through the overlay")
+	}
+	if v, _ := store.Get("a"); v != "1" {
+		t.Errorf("parent should still have a=1 before Write, got %q", v)
+	}
+
+	cache.Write()
+	if store.Exists("a") {
+		t.Error("a should be gone from the parent after Write")
+	}
+}
+
+func TestCacheStoreNesting(t *testing.T) {
+	store := NewStore()
+	store.Set("a", "1")
+
+	outer := store.CacheWrap()
+	outer.Set("a", "2")
+
+	inner := outer.CacheWrap()
+	if v, ok := inner.Get("a"); !ok || v != "2" {
+		t.Errorf("inner should read through to outer's staged value, got %q, %v", v, ok)
+	}
+	inner.Set("a", "3")
+
+	if v, _ := outer.Get("a"); v != "2" {
+		t.Errorf("outer should be unaffected before inner.Write(), got %q", v)
+	}
+
+	inner.Write()
+	if v, _ := outer.Get("a"); v != "3" {
+		t.Errorf("outer should see 3 after inner.Write(), got %q", v)
+	}
+	if v, _ := store.Get("a"); v != "1" {
+		t.Errorf("store should still be 1 until outer.Write(), got %q", v)
+	}
+
+	outer.Write()
+	if v, _ := store.Get("a"); v != "3" {
+		t.Errorf("store should be 3 after outer.Write(), got %q", v)
+	}
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"container/list"
+	"sync/atomic"
+)
+
+// EvictionPolicy decides which key a Store should evict once it reaches
+// Options.MaxEntries. Store serializes every call to a given policy
+// behind its own lock, so implementations don't need to be safe for
+// concurrent use.
+type EvictionPolicy interface {
+	// RecordAccess notes that key was read (Get/Exists) or overwritten
+	// (Set on an existing key).
+	RecordAccess(key string)
+	// RecordInsert notes that key was written for the first time.
+	RecordInsert(key string)
+	// RecordDelete notes that key is gone, whether from an explicit
+	// Delete, TTL expiry or Clear. It is not called for a key the
+	// policy itself returned from Evict.
+	RecordDelete(key string)
+	// Evict picks a key to remove and forgets about it, the same as a
+	// RecordDelete for that key. ok is false if the policy has nothing
+	// left to evict.
+	Evict() (key string, ok bool)
+}
+
+// lruPolicy is a classic least-recently-used policy: a doubly linked
+// list ordered from most- to least-recently used, with a map to each
+// key's list element for O(1) access.
+type lruPolicy struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+// NewLRUPolicy returns an EvictionPolicy that evicts the
+// least-recently-used key: the key that was inserted or accessed
+// longest ago.
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{
+		order: list.New(),
+		elems: make(map[string]*list.Element),
+	}
+}
+
+func (p *lruPolicy) RecordInsert(key string) {
+	if elem, ok := p.elems[key]; ok {
+		p.order.MoveToFront(elem)
+		return
+	}
+	p.elems[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) RecordAccess(key string) {
+	if elem, ok := p.elems[key]; ok {
+		p.order.MoveToFront(elem)
+	}
+}
+
+func (p *lruPolicy) RecordDelete(key string) {
+	if elem, ok := p.elems[key]; ok {
+		p.order.Remove(elem)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy) Evict() (string, bool) {
+	back := p.order.Back()
+	if back == nil {
+		return "", false
+	}
+	key := back.Value.(string)
+	p.order.Remove(back)
+	delete(p.elems, key)
+	return key, true
+}
+
+// freqBucket holds every key currently at a given access frequency.
+// lfuPolicy keeps buckets in a list ordered by ascending freq, so the
+// lowest-frequency bucket - the one Evict() pops from - is always at
+// the front.
+type freqBucket struct {
+	freq  int
+	items *list.List // elements are keys (string), front = most recently touched at this freq
+}
+
+// lfuPolicy is an O(1) least-frequently-used policy (the frequency-list
+// algorithm): a doubly linked list of frequency buckets, each holding a
+// doubly linked list of the keys currently at that frequency. An access
+// moves a key from its current bucket to the next-higher one, creating
+// it if it doesn't exist yet; an evict pops the least-recently-touched
+// key from the lowest-frequency bucket.
+type lfuPolicy struct {
+	buckets *list.List               // elements are *freqBucket, ascending by freq
+	keyNode map[string]*list.Element // key -> its bucket's element in buckets
+	keyItem map[string]*list.Element // key -> its element within that bucket's items
+}
+
+// NewLFUPolicy returns an EvictionPolicy that evicts the
+// least-frequently-used key, breaking ties in favor of the
+// least-recently-touched key at that frequency.
+func NewLFUPolicy() EvictionPolicy {
+	return &lfuPolicy{
+		buckets: list.New(),
+		keyNode: make(map[string]*list.Element),
+		keyItem: make(map[string]*list.Element),
+	}
+}
+
+func (p *lfuPolicy) RecordInsert(key string) {
+	if _, ok := p.keyNode[key]; ok {
+		p.RecordAccess(key)
+		return
+	}
+
+	front := p.buckets.Front()
+	var node *list.Element
+	if front != nil && front.Value.(*freqBucket).freq == 1 {
+		node = front
+	} else {
+		node = p.buckets.PushFront(&freqBucket{freq: 1, items: list.New()})
+	}
+
+	bucket := node.Value.(*freqBucket)
+	p.keyItem[key] = bucket.items.PushFront(key)
+	p.keyNode[key] = node
+}
+
+func (p *lfuPolicy) RecordAccess(key string) {
+	node, ok := p.keyNode[key]
+	if !ok {
+		p.RecordInsert(key)
+		return
+	}
+	bucket := node.Value.(*freqBucket)
+	bucket.items.Remove(p.keyItem[key])
+
+	next := node.Next()
+	var target *list.Element
+	if next != nil && next.Value.(*freqBucket).freq == bucket.freq+1 {
+		target = next
+	} else {
+		target = p.buckets.InsertAfter(&freqBucket{freq: bucket.freq + 1, items: list.New()}, node)
+	}
+
+	targetBucket := target.Value.(*freqBucket)
+	p.keyItem[key] = targetBucket.items.PushFront(key)
+	p.keyNode[key] = target
+
+	if bucket.items.Len() == 0 {
+		p.buckets.Remove(node)
+	}
+}
+
+func (p *lfuPolicy) RecordDelete(key string) {
+	node, ok := p.keyNode[key]
+	if !ok {
+		return
+	}
+	bucket := node.Value.(*freqBucket)
+	bucket.items.Remove(p.keyItem[key])
+	delete(p.keyItem, key)
+	delete(p.keyNode, key)
+	if bucket.items.Len() == 0 {
+		p.buckets.Remove(node)
+	}
+}
+
+func (p *lfuPolicy) Evict() (string, bool) {
+	front := p.buckets.Front()
+	if front == nil {
+		return "", false
+	}
+	bucket := front.Value.(*freqBucket)
+	back := bucket.items.Back()
+	if back == nil {
+		return "", false
+	}
+	key := back.Value.(string)
+	bucket.items.Remove(back)
+	delete(p.keyItem, key)
+	delete(p.keyNode, key)
+	if bucket.items.Len() == 0 {
+		p.buckets.Remove(front)
+	}
+	return key, true
+}
+
+// HitRate returns the fraction of Get calls that found a live value,
+// since the store was created. It returns 0 if Get has never been
+// called.
+func (s *Store) HitRate() float64 {
+	hits := atomic.LoadInt64(s.hits)
+	misses := atomic.LoadInt64(s.misses)
+	total := hits + misses
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+// EvictionCount returns the number of keys the store's eviction policy
+// has evicted since creation. It is always 0 when no policy is
+// configured.
+func (s *Store) EvictionCount() int64 {
+	return atomic.LoadInt64(s.evictions)
+}
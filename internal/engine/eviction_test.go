@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestLRUPolicyEvictsLeastRecentlyUsed(t *testing.T) {
+	p := NewLRUPolicy()
+	p.RecordInsert("a")
+	p.RecordInsert("b")
+	p.RecordInsert("c")
+	p.RecordAccess("a") // a is now the most recently used
+
+	key, ok := p.Evict()
+	if !ok || key != "b" {
+		t.Fatalf("Evict() = %q, %v, want b, true", key, ok)
+	}
+	key, ok = p.Evict()
+	if !ok || key != "c" {
+		t.Fatalf("Evict() = %q, %v, want c, true", key, ok)
+	}
+	key, ok = p.Evict()
+	if !ok || key != "a" {
+		t.Fatalf("Evict() = %q, %v, want a, true", key, ok)
+	}
+	if _, ok := p.Evict(); ok {
+		t.Error("Evict() on an empty policy should report ok=false")
+	}
+}
+
+func TestLRUPolicyRecordDelete(t *testing.T) {
+	p := NewLRUPolicy()
+	p.RecordInsert("a")
+	p.RecordInsert("b")
+	p.RecordDelete("a")
+
+	key, ok := p.Evict()
+	if !ok || key != "b" {
+		t.Fatalf("Evict() = %q, %v, want b, true (a was deleted)", key, ok)
+	}
+}
+
+func TestLFUPolicyEvictsLeastFrequentlyUsed(t *testing.T) {
+	p := NewLFUPolicy()
+	p.RecordInsert("a")
+	p.RecordInsert("b")
+	p.RecordInsert("c")
+
+	// a and b are accessed repeatedly; c is never touched again, so it
+	// has the lowest frequency and should go first.
+	p.RecordAccess("a")
+	p.RecordAccess("a")
+	p.RecordAccess("b")
+
+	key, ok := p.Evict()
+	if !ok || key != "c" {
+		t.Fatalf("Evict() = %q, %v, want c, true", key, ok)
+	}
+	key, ok = p.Evict()
+	if !ok || key != "b" {
+		t.Fatalf("Evict() = %q, %v, want b, true (fewer accesses than a)", key, ok)
+	}
+	key, ok = p.Evict()
+	if !ok || key != "a" {
+		t.Fatalf("Evict() = %q, %v, want a, true", key, ok)
+	}
+}
+
+func TestLFUPolicyTiesBreakByRecency(t *testing.T) {
+	p := NewLFUPolicy()
+	p.RecordInsert("a")
+	p.RecordInsert("b")
+	// Both a and b are at frequency 1; b was touched more recently.
+	p.RecordAccess("b")
+	p.RecordAccess("a")
+
+	// a and b are now both at frequency 2; a was touched most recently,
+	// so b (the older of the two) should be evicted first.
+	key, ok := p.Evict()
+	if !ok || key != "b" {
+		t.Fatalf("Evict() = %q, %v, want b, true", key, ok)
+	}
+}
+
+func TestStoreEvictsWhenMaxEntriesReached(t *testing.T) {
+	store := NewStoreWithOptions(Options{MaxEntries: 2, Policy: NewLRUPolicy()})
+	defer store.Close()
+
+	store.Set("a", "1")
+	store.Set("b", "2")
+	store.Set("c", "3") // evicts a, the least recently used
+
+	if store.Exists("a") {
+		t.Error("a should have been evicted")
+	}
+	if !store.Exists("b") || !store.Exists("c") {
+		t.Error("b and c should both still be present")
+	}
+	if store.Size() != 2 {
+		t.Errorf("Size() = %d, want 2", store.Size())
+	}
+	if store.EvictionCount() != 1 {
+		t.Errorf("EvictionCount() = %d, want 1", store.EvictionCount())
+	}
+}
+
+func TestStoreEvictionOverwriteDoesNotEvict(t *testing.T) {
+	store := NewStoreWithOptions(Options{MaxEntries: 2, Policy: NewLRUPolicy()})
+	defer store.Close()
+
+	store.Set("a", "1")
+	store.Set("b", "2")
+	store.Set("a", "updated") // overwrite, not an insert; should not evict b
+
+	if !store.Exists("b") {
+		t.Error("b should not be evicted by an overwrite of an existing key")
+	}
+	if v, _ := store.Get("a"); v != "updated" {
+		t.Errorf("Get(a) = %q, want updated", v)
+	}
+	if store.EvictionCount() != 0 {
+		t.Errorf("EvictionCount() = %d, want 0", store.EvictionCount())
+	}
+}
+
+// TestConcurrentSetOfSameNewKeyDoesNotOvercountEntries races many
+// goroutines inserting the exact same brand-new key at once. If Set
+// ever lets two of them both believe they're the one doing the insert,
+// entryCount gets incremented once per racer instead of once for the
+// key, even though only one key was ever actually created - and a
+// later insert of an unrelated key would then trigger eviction that
+// shouldn't happen yet.
+func TestConcurrentSetOfSameNewKeyDoesNotOvercountEntries(t *testing.T) {
+	store := NewStoreWithOptions(Options{MaxEntries: 3, Policy: NewLRUPolicy()})
+	defer store.Close()
+
+	const racers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Set("shared", "v")
+		}()
+	}
+	wg.Wait()
+
+	store.Set("a", "1")
+	store.Set("b", "2")
+
+	if got := store.Size(); got != 3 {
+		t.Errorf("Size() = %d, want 3 (shared, a, b all fit within MaxEntries)", got)
+	}
+	if got := store.EvictionCount(); got != 0 {
+		t.Errorf("EvictionCount() = %d, want 0 (entryCount must not have been overcounted)", got)
+	}
+}
+
+func TestStoreHitRate(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("a", "1")
+	store.Get("a")
+	store.Get("a")
+	store.Get("missing")
+
+	if got := store.HitRate(); got != 2.0/3.0 {
+		t.Errorf("HitRate() = %v, want %v", got, 2.0/3.0)
+	}
+}
+
+func TestStoreHitRateWithNoGets(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if got := store.HitRate(); got != 0 {
+		t.Errorf("HitRate() = %v, want 0", got)
+	}
+}
+
+// TestLFUOutperformsLRUUnderScanPattern exercises the classic case where
+// a naive LRU thrashes: a small set of "hot" keys is accessed
+// repeatedly, interleaved with a long scan over "cold" keys that are
+// each touched exactly once. Under LRU, the scan pushes every hot key
+// out before it's looked up again. LFU remembers that the hot keys are
+// accessed far more often and keeps them resident throughout.
+func TestLFUOutperformsLRUUnderScanPattern(t *testing.T) {
+	const hotKeys = 5
+	const maxEntries = 10
+	const scanLength = 100
+
+	run := func(policy EvictionPolicy) float64 {
+		store := NewStoreWithOptions(Options{MaxEntries: maxEntries, Policy: policy})
+		defer store.Close()
+
+		for i := 0; i < hotKeys; i++ {
+			store.Set(fmt.Sprintf("hot-%d", i), "v")
+		}
+		// Warm up the hot keys so LFU records them as frequently used.
+		for round := 0; round < 3; round++ {
+			for i := 0; i < hotKeys; i++ {
+				store.Get(fmt.Sprintf("hot-%d", i))
+			}
+		}
+
+		for i := 0; i < scanLength; i++ {
+			store.Set(fmt.Sprintf("cold-%d", i), "v")
+		}
+
+		hits := 0
+		for i := 0; i < hotKeys; i++ {
+			if store.Exists(fmt.Sprintf("hot-%d", i)) {
+				hits++
+			}
+		}
+		return float64(hits) / hotKeys
+	}
+
+	lruSurvival := run(NewLRUPolicy())
+	lfuSurvival := run(NewLFUPolicy())
+
+	if lruSurvival >= lfuSurvival {
+		t.Errorf("expected LFU to retain more hot keys than LRU under a scan, got lru=%v lfu=%v", lruSurvival, lfuSurvival)
+	}
+	if lfuSurvival == 0 {
+		t.Error("expected LFU to retain at least one hot key")
+	}
+}
@@ -0,0 +1,173 @@
+package engine
+
+import "sort"
+
+// Iterator walks a range of a Store's keys in sorted order. It is
+// modeled on the iterator APIs used by goleveldb and tendermint's db
+// package: call Next() to advance, then read Key()/Value(), and check
+// Error() once the iterator is exhausted to distinguish "ran out" from
+// "something went wrong". The iterator is a snapshot taken at the
+// moment it was created, so concurrent writes to the store never
+// invalidate it and never show up mid-scan.
+type Iterator interface {
+	// Next advances the iterator and reports whether a new entry is
+	// available. It must be called once before the first Key()/Value().
+	Next() bool
+	// Key returns the current entry's key.
+	Key() string
+	// Value returns the current entry's value.
+	Value() string
+	// Error returns any error encountered while iterating.
+	Error() error
+	// Close releases resources held by the iterator.
+	Close()
+}
+
+// sliceIterator is the only Iterator implementation: a pre-filtered,
+// pre-ordered snapshot of keys/values that Next() walks one step at a
+// time, optionally back to front.
+type sliceIterator struct {
+	keys    []string
+	values  []string
+	pos     int
+	reverse bool
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.reverse {
+		it.pos--
+		return it.pos >= 0
+	}
+	it.pos++
+	return it.pos < len(it.keys)
+}
+
+func (it *sliceIterator) Key() string {
+	return it.keys[it.pos]
+}
+
+func (it *sliceIterator) Value() string {
+	return it.values[it.pos]
+}
+
+func (it *sliceIterator) Error() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() {
+	it.keys = nil
+	it.values = nil
+}
+
+// Iterator returns an Iterator over keys in [start, end) in ascending
+// order. An empty start means "from the first key"; an empty end means
+// "through the last key".
+func (s *Store) Iterator(start, end string) Iterator {
+	return s.newRangeIterator(start, end, false)
+}
+
+// ReverseIterator returns an Iterator over keys in [start, end), walked
+// in descending order. Bounds follow the same convention as Iterator.
+func (s *Store) ReverseIterator(start, end string) Iterator {
+	return s.newRangeIterator(start, end, true)
+}
+
+// PrefixScan returns an Iterator over every key with the given prefix,
+// in ascending order.
+func (s *Store) PrefixScan(prefix string) Iterator {
+	start := prefix
+	end := prefixUpperBound(prefix)
+	return s.newRangeIterator(start, end, false)
+}
+
+func (s *Store) newRangeIterator(start, end string, reverse bool) Iterator {
+	unlock := rlockShardsAscending(s.shards)
+	var allKeys []string
+	var allValues []entry
+	for _, sh := range s.shards {
+		ks, vs := sh.data.Snapshot()
+		allKeys = append(allKeys, ks...)
+		allValues = append(allValues, vs...)
+	}
+	unlock()
+
+	sort.Sort(&keyValueSlice{keys: allKeys, values: allValues})
+
+	startFull, endFull := s.keyFor(start), ""
+	if end != "" {
+		endFull = s.keyFor(end)
+	}
+
+	lo := 0
+	if startFull != "" {
+		lo = sort.SearchStrings(allKeys, startFull)
+	} else if s.prefix != "" {
+		lo = sort.SearchStrings(allKeys, s.prefix)
+	}
+
+	hi := len(allKeys)
+	if endFull != "" {
+		hi = sort.SearchStrings(allKeys, endFull)
+	} else if s.prefix != "" {
+		if upper := prefixUpperBound(s.prefix); upper != "" {
+			hi = sort.SearchStrings(allKeys, upper)
+		}
+	}
+	if hi < lo {
+		hi = lo
+	}
+
+	rangeKeys := allKeys[lo:hi]
+	rangeValues := allValues[lo:hi]
+
+	keys := make([]string, 0, len(rangeKeys))
+	values := make([]string, 0, len(rangeKeys))
+	for i, k := range rangeKeys {
+		if rangeValues[i].expired() {
+			continue
+		}
+		keys = append(keys, k)
+		values = append(values, rangeValues[i].value)
+	}
+	keys = s.unprefixed(keys)
+
+	it := &sliceIterator{keys: keys, values: values, reverse: reverse}
+	if reverse {
+		it.pos = len(keys)
+	} else {
+		it.pos = -1
+	}
+	return it
+}
+
+// keyValueSlice sorts parallel key/value slices by key, so that keys
+// gathered shard by shard (each shard is independently ordered, but the
+// shards are interleaved with respect to each other) can be merged back
+// into one globally sorted sequence.
+type keyValueSlice struct {
+	keys   []string
+	values []entry
+}
+
+func (s *keyValueSlice) Len() int { return len(s.keys) }
+func (s *keyValueSlice) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
+func (s *keyValueSlice) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+
+// prefixUpperBound returns the smallest key that is strictly greater
+// than every key with the given prefix, by incrementing its last byte
+// that isn't already 0xff and truncating the rest. If prefix is empty,
+// or consists entirely of 0xff bytes, there is no such bound and the
+// scan is unbounded above.
+func prefixUpperBound(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] != 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
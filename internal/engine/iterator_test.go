@@ -0,0 +1,120 @@
+package engine
+
+import "testing"
+
+func collect(it Iterator) (keys, values []string) {
+	defer it.Close()
+	for it.Next() {
+		keys = append(keys, it.Key())
+		values = append(values, it.Value())
+	}
+	return keys, values
+}
+
+func TestIteratorAscending(t *testing.T) {
+	store := NewStore()
+	store.Set("b", "2")
+	store.Set("a", "1")
+	store.Set("c", "3")
+
+	keys, values := collect(store.Iterator("", ""))
+	if got, want := keys, []string{"a", "b", "c"}; !equalStrings(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+	if got, want := values, []string{"1", "2", "3"}; !equalStrings(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+}
+
+func TestIteratorRange(t *testing.T) {
+	store := NewStore()
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		store.Set(k, k)
+	}
+
+	keys, _ := collect(store.Iterator("b", "d"))
+	if want := []string{"b", "c"}; !equalStrings(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestReverseIterator(t *testing.T) {
+	store := NewStore()
+	for _, k := range []string{"a", "b", "c"} {
+		store.Set(k, k)
+	}
+
+	keys, _ := collect(store.ReverseIterator("", ""))
+	if want := []string{"c", "b", "a"}; !equalStrings(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestPrefixScan(t *testing.T) {
+	store := NewStore()
+	store.Set("user:1", "alice")
+	store.Set("user:2", "bob")
+	store.Set("order:1", "widget")
+
+	keys, _ := collect(store.PrefixScan("user:"))
+	if want := []string{"user:1", "user:2"}; !equalStrings(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestIteratorSnapshotIsolation(t *testing.T) {
+	store := NewStore()
+	store.Set("a", "1")
+	store.Set("b", "2")
+
+	it := store.Iterator("", "")
+	store.Set("c", "3")
+	store.Delete("a")
+
+	keys, _ := collect(it)
+	if want := []string{"a", "b"}; !equalStrings(keys, want) {
+		t.Errorf("iterator should see a point-in-time snapshot, got %v want %v", keys, want)
+	}
+}
+
+func TestPrefixStore(t *testing.T) {
+	root := NewStore()
+	users := root.PrefixStore("user:")
+	orders := root.PrefixStore("order:")
+
+	users.Set("1", "alice")
+	orders.Set("1", "widget")
+
+	if v, ok := users.Get("1"); !ok || v != "alice" {
+		t.Errorf("users.Get(1) = %q, %v", v, ok)
+	}
+	if v, ok := root.Get("user:1"); !ok || v != "alice" {
+		t.Errorf("root.Get(user:1) = %q, %v", v, ok)
+	}
+	if got := users.Keys(); !equalStrings(got, []string{"1"}) {
+		t.Errorf("users.Keys() = %v, want [1]", got)
+	}
+	if got := orders.Keys(); !equalStrings(got, []string{"1"}) {
+		t.Errorf("orders.Keys() = %v, want [1]", got)
+	}
+
+	users.Clear()
+	if users.Size() != 0 {
+		t.Errorf("users.Size() after Clear = %d, want 0", users.Size())
+	}
+	if orders.Size() != 1 {
+		t.Errorf("orders.Size() should be unaffected by users.Clear(), got %d", orders.Size())
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,452 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Options configures a persistent Store.
+type Options struct {
+	// SyncWrites causes every mutating call to fsync the WAL before
+	// returning, trading throughput for durability. When false, writes
+	// are only guaranteed to survive a process crash once the OS flushes
+	// its page cache.
+	SyncWrites bool
+
+	// CheckpointBytes is the WAL size, in bytes, at which the store
+	// automatically writes a new snapshot and truncates the log. A
+	// value of 0 disables automatic checkpointing; callers can still
+	// invoke Store.Checkpoint() manually.
+	CheckpointBytes int64
+
+	// MaxEntries bounds the number of live entries the store will hold.
+	// Once reached, inserting a new key evicts existing keys first,
+	// chosen by Policy. A value of 0 (with Policy left nil) disables
+	// eviction, the default.
+	MaxEntries int
+
+	// Policy decides which key to evict once MaxEntries is reached. See
+	// EvictionPolicy, NewLRUPolicy and NewLFUPolicy.
+	Policy EvictionPolicy
+}
+
+const (
+	opSet byte = iota + 1
+	opDelete
+	opClear
+)
+
+const snapshotFileName = "snapshot.db"
+const walFileName = "wal.log"
+
+// NewPersistentStore opens (or creates) a durable Store backed by files
+// under dir: a snapshot (snapshotFileName) and an append-only
+// write-ahead log (walFileName). On open, the snapshot is loaded first
+// and the WAL is then replayed on top of it, so the store's state picks
+// up exactly where it left off.
+func NewPersistentStore(dir string, opts Options) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("engine: create store dir: %w", err)
+	}
+
+	// Loading is single-threaded, so build a bare store and only start
+	// its sweeper goroutine once the snapshot and WAL have been
+	// replayed into it.
+	s := newBareStore(opts)
+	s.dir = dir
+	s.persistent = true
+
+	if err := s.loadSnapshot(filepath.Join(dir, snapshotFileName)); err != nil {
+		return nil, fmt.Errorf("engine: load snapshot: %w", err)
+	}
+
+	if err := s.replayWAL(filepath.Join(dir, walFileName)); err != nil {
+		return nil, fmt.Errorf("engine: replay wal: %w", err)
+	}
+
+	if s.opts.Policy != nil {
+		// Nothing else can be touching the store yet, so this can walk
+		// every shard and seed the policy without any locking.
+		var loaded int64
+		for _, sh := range s.shards {
+			keys, _ := sh.data.Snapshot()
+			for _, k := range keys {
+				s.opts.Policy.RecordInsert(k)
+				loaded++
+			}
+		}
+		atomic.StoreInt64(s.entryCount, loaded)
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("engine: open wal: %w", err)
+	}
+	info, err := wal.Stat()
+	if err != nil {
+		wal.Close()
+		return nil, fmt.Errorf("engine: stat wal: %w", err)
+	}
+	s.wal = wal
+	s.walSize = info.Size()
+
+	go s.runTTLSweeper()
+	return s, nil
+}
+
+// loadSnapshot populates the store from the snapshot file, if present.
+// A missing snapshot simply means the store starts empty.
+func (s *Store) loadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		key, value, err := readRecordPair(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.shardFor(key).data.Set(key, entry{value: value})
+	}
+}
+
+// replayWAL re-applies every record written since the last snapshot. A
+// record's integrity is checked with crc32; the first corrupt or
+// truncated record stops replay, since it can only be the tail of a
+// write that never completed.
+func (s *Store) replayWAL(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		op, key, value, ok := readWALRecord(r)
+		if !ok {
+			return nil
+		}
+		switch op {
+		case opSet:
+			s.shardFor(key).data.Set(key, entry{value: value})
+		case opDelete:
+			s.shardFor(key).data.Delete(key)
+		case opClear:
+			for _, sh := range s.shards {
+				sh.data.Clear()
+			}
+		}
+	}
+}
+
+// appendWAL serializes a single mutation as: 1-byte op code, varint key
+// length, key bytes, varint value length, value bytes, crc32 of
+// everything preceding it. Delete and Clear records omit the value.
+func (s *Store) appendWAL(op byte, key, value string) error {
+	if !s.persistent {
+		return nil
+	}
+
+	if err := s.appendWALRaw(op, key, value); err != nil {
+		return err
+	}
+
+	if s.opts.SyncWrites {
+		s.walMu.Lock()
+		err := s.wal.Sync()
+		s.walMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("engine: sync wal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// appendWALRaw writes a single record without syncing or checking for a
+// checkpoint; appendWAL adds the fsync on top. Batch doesn't use it: it
+// writes its whole group through appendWALBatch instead.
+func (s *Store) appendWALRaw(op byte, key, value string) error {
+	if !s.persistent {
+		return nil
+	}
+
+	buf := encodeWALRecord(op, key, value)
+
+	s.walMu.Lock()
+	n, err := s.wal.Write(buf)
+	if err == nil {
+		s.walSize += int64(n)
+	}
+	s.walMu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("engine: write wal record: %w", err)
+	}
+	return nil
+}
+
+// appendWALBatch encodes every op in ops and writes them as a single
+// buffer in one call, so the group lands in the WAL in full or not at
+// all - see Batch.write, the only caller, for why that matters.
+func (s *Store) appendWALBatch(ops []batchOp) error {
+	if !s.persistent {
+		return nil
+	}
+
+	buf := make([]byte, 0, len(ops)*32)
+	for _, op := range ops {
+		buf = append(buf, encodeWALRecord(op.op, op.key, op.value)...)
+	}
+
+	s.walMu.Lock()
+	n, err := s.wal.Write(buf)
+	if err == nil {
+		s.walSize += int64(n)
+	} else if n > 0 {
+		// Cut off whatever part of the group did land, so a short write
+		// can't leave a replayable prefix of the batch in the log.
+		s.wal.Truncate(s.walSize)
+	}
+	s.walMu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("engine: write wal batch: %w", err)
+	}
+	return nil
+}
+
+// maybeCheckpoint runs a Checkpoint once the WAL has grown past
+// opts.CheckpointBytes. Callers invoke it only after releasing any
+// shard locks they held for the mutation that triggered the check,
+// since Checkpoint needs to lock every shard in turn and Go's
+// sync.RWMutex is not reentrant. The checkpointing flag collapses
+// concurrent triggers from multiple goroutines into a single
+// Checkpoint call.
+func (s *Store) maybeCheckpoint() {
+	if s.opts.CheckpointBytes <= 0 {
+		return
+	}
+
+	s.walMu.Lock()
+	due := s.walSize >= s.opts.CheckpointBytes
+	s.walMu.Unlock()
+	if !due {
+		return
+	}
+
+	if atomic.CompareAndSwapInt32(&s.checkpointing, 0, 1) {
+		defer atomic.StoreInt32(&s.checkpointing, 0)
+		s.Checkpoint()
+	}
+}
+
+func encodeWALRecord(op byte, key, value string) []byte {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64*2+len(key)+len(value)+4)
+	buf = append(buf, op)
+	buf = appendVarintString(buf, key)
+	if op == opSet {
+		buf = appendVarintString(buf, value)
+	}
+	sum := crc32.ChecksumIEEE(buf)
+	return binary.LittleEndian.AppendUint32(buf, sum)
+}
+
+func appendVarintString(buf []byte, s string) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(s)))
+	buf = append(buf, lenBuf[:n]...)
+	return append(buf, s...)
+}
+
+// readWALRecord reads one record written by encodeWALRecord, returning
+// ok=false once the log is exhausted or the next record fails its
+// checksum (a sign the process crashed mid-write).
+func readWALRecord(r *bufio.Reader) (op byte, key, value string, ok bool) {
+	start := make([]byte, 0, 64)
+
+	opByte, err := r.ReadByte()
+	if err != nil {
+		return 0, "", "", false
+	}
+	start = append(start, opByte)
+
+	key, n1, err := readVarintStringTracked(r, &start)
+	if err != nil {
+		return 0, "", "", false
+	}
+	_ = n1
+
+	if opByte == opSet {
+		value, _, err = readVarintStringTracked(r, &start)
+		if err != nil {
+			return 0, "", "", false
+		}
+	}
+
+	var wantSum uint32
+	if err := binary.Read(r, binary.LittleEndian, &wantSum); err != nil {
+		return 0, "", "", false
+	}
+	gotSum := crc32.ChecksumIEEE(start)
+	if gotSum != wantSum {
+		return 0, "", "", false
+	}
+
+	return opByte, key, value, true
+}
+
+// readVarintStringTracked reads a varint-prefixed string from r,
+// appending every byte it consumes to *tracked so the caller can
+// checksum exactly what was read.
+func readVarintStringTracked(r *bufio.Reader, tracked *[]byte) (string, int, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", 0, err
+	}
+	*tracked = appendUvarint(*tracked, length)
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", 0, err
+	}
+	*tracked = append(*tracked, buf...)
+	return string(buf), len(buf), nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], v)
+	return append(buf, lenBuf[:n]...)
+}
+
+// readRecordPair reads a snapshot entry, which is a Set record without
+// its op code or checksum suffix: just the varint-prefixed key followed
+// by the varint-prefixed value (the snapshot file is rewritten wholesale
+// on every checkpoint, so per-entry corruption detection isn't needed).
+func readRecordPair(r *bufio.Reader) (key, value string, err error) {
+	key, _, err = readVarintStringTracked(r, &[]byte{})
+	if err != nil {
+		return "", "", err
+	}
+	value, _, err = readVarintStringTracked(r, &[]byte{})
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// Checkpoint writes the current contents of the store to a fresh
+// snapshot file and truncates the WAL, so future restarts replay less
+// history. It is safe to call concurrently with other store operations:
+// every shard is write-locked, in the established ascending order, for
+// the whole read-then-truncate sequence below, so no Set/Delete can land
+// in the gap between the snapshot being read and the WAL being
+// truncated. Without that, a write landing in that gap would end up in
+// neither the new snapshot nor the (now-truncated) WAL, and would be
+// silently lost on the next restart even though the call that made it
+// had already returned successfully.
+func (s *Store) Checkpoint() error {
+	if !s.persistent {
+		return fmt.Errorf("engine: store is not persistent")
+	}
+
+	unlock := lockShardsAscending(s.shards)
+	defer unlock()
+
+	type kv struct {
+		key, value string
+	}
+	var live []kv
+	for _, sh := range s.shards {
+		keys, values := sh.data.Snapshot()
+		for i, k := range keys {
+			// Expiry isn't part of the on-disk format, so there's no
+			// reason to carry an already-expired entry forward.
+			if !values[i].expired() {
+				live = append(live, kv{k, values[i].value})
+			}
+		}
+	}
+
+	tmpPath := filepath.Join(s.dir, snapshotFileName+".tmp")
+	finalPath := filepath.Join(s.dir, snapshotFileName)
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("engine: create snapshot tmp: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	for _, e := range live {
+		if _, err := w.Write(appendVarintString(appendVarintString(nil, e.key), e.value)); err != nil {
+			f.Close()
+			return fmt.Errorf("engine: write snapshot: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("engine: flush snapshot: %w", err)
+	}
+	if s.opts.SyncWrites {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return fmt.Errorf("engine: sync snapshot: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("engine: close snapshot tmp: %w", err)
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return fmt.Errorf("engine: rename snapshot: %w", err)
+	}
+
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("engine: truncate wal: %w", err)
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("engine: seek wal: %w", err)
+	}
+	s.walSize = 0
+	return nil
+}
+
+// Close releases resources held by the store: it stops the active-TTL
+// sweeper goroutine (if this is a root store, i.e. not one returned by
+// PrefixStore) and, if the store is persistent, closes the WAL file. A
+// closed store must not be used again.
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() {
+		if s.stopSweep != nil {
+			close(s.stopSweep)
+		}
+	})
+
+	if !s.persistent {
+		return nil
+	}
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	return s.wal.Close()
+}
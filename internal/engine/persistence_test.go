@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestPersistentStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewPersistentStore(dir, Options{SyncWrites: true})
+	if err != nil {
+		t.Fatalf("NewPersistentStore failed: %v", err)
+	}
+
+	store.Set("a", "1")
+	store.Set("b", "2")
+	store.Delete("a")
+	store.Set("c", "3")
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := NewPersistentStore(dir, Options{SyncWrites: true})
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer reopened.Close()
+
+	if _, exists := reopened.Get("a"); exists {
+		t.Error("deleted key 'a' should not reappear after reopen")
+	}
+	if v, exists := reopened.Get("b"); !exists || v != "2" {
+		t.Errorf("expected b=2, got %q exists=%v", v, exists)
+	}
+	if v, exists := reopened.Get("c"); !exists || v != "3" {
+		t.Errorf("expected c=3, got %q exists=%v", v, exists)
+	}
+}
+
+func TestPersistentStoreCheckpointTruncatesWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewPersistentStore(dir, Options{CheckpointBytes: 1 << 30})
+	if err != nil {
+		t.Fatalf("NewPersistentStore failed: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		store.Set(string(rune('a'+i%26)), "value")
+	}
+
+	if err := store.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if store.walSize != 0 {
+		t.Errorf("expected wal to be truncated, size is %d", store.walSize)
+	}
+	store.Close()
+
+	reopened, err := NewPersistentStore(dir, Options{})
+	if err != nil {
+		t.Fatalf("reopen after checkpoint failed: %v", err)
+	}
+	defer reopened.Close()
+
+	if v, exists := reopened.Get("a"); !exists || v != "value" {
+		t.Errorf("expected checkpointed value to survive, got %q exists=%v", v, exists)
+	}
+}
+
+func TestPersistentStoreAutoCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewPersistentStore(dir, Options{CheckpointBytes: 64})
+	if err != nil {
+		t.Fatalf("NewPersistentStore failed: %v", err)
+	}
+	defer store.Close()
+
+	for i := 0; i < 50; i++ {
+		store.Set("key", "some reasonably sized value to grow the wal")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("expected a snapshot file to have been written: %v", err)
+	}
+}
+
+// TestPersistentStoreConcurrentWritesSurviveCheckpoint writes from many
+// goroutines at once against a store whose small CheckpointBytes makes
+// auto-checkpointing fire constantly throughout the run, then reopens
+// the store - without an explicit final Checkpoint first - and checks
+// that every write that returned successfully is still there. This is
+// the concurrent counterpart to TestPersistentStoreSurvivesRestart: it
+// exercises the window a checkpoint racing real writers would need to
+// lose data in, by reopening on exactly the state those in-flight
+// auto-checkpoints plus the residual WAL tail left on disk.
+func TestPersistentStoreConcurrentWritesSurviveCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewPersistentStore(dir, Options{CheckpointBytes: 256})
+	if err != nil {
+		t.Fatalf("NewPersistentStore failed: %v", err)
+	}
+
+	const goroutines = 20
+	const perGoroutine = 50
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				key := fmt.Sprintf("g%d-k%d", g, i)
+				if err := store.Set(key, "value"); err != nil {
+					t.Errorf("Set(%s) failed: %v", key, err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// No final explicit Checkpoint here: the point is to reopen relying
+	// only on whatever auto-checkpoints fired during the concurrent
+	// writes plus the residual WAL tail, the same state a real process
+	// would be left in. A clean re-snapshot of all in-memory state right
+	// before Close would recapture every write regardless of whether
+	// the checkpoint-vs-writer race was actually fixed, making the
+	// assertion below unable to fail either way.
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := NewPersistentStore(dir, Options{})
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer reopened.Close()
+
+	for g := 0; g < goroutines; g++ {
+		for i := 0; i < perGoroutine; i++ {
+			key := fmt.Sprintf("g%d-k%d", g, i)
+			if v, exists := reopened.Get(key); !exists || v != "value" {
+				t.Errorf("Get(%s) after reopen = %q, %v, want \"value\", true", key, v, exists)
+			}
+		}
+	}
+}
+
+func TestPersistentStoreStopsAtCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewPersistentStore(dir, Options{})
+	if err != nil {
+		t.Fatalf("NewPersistentStore failed: %v", err)
+	}
+	store.Set("good", "1")
+	store.Close()
+
+	walPath := filepath.Join(dir, walFileName)
+	f, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open wal for corruption: %v", err)
+	}
+	if _, err := f.Write([]byte{opSet, 0x03, 'b', 'a', 'd', 0xff, 0xff, 0xff, 0xff}); err != nil {
+		t.Fatalf("write garbage: %v", err)
+	}
+	f.Close()
+
+	reopened, err := NewPersistentStore(dir, Options{})
+	if err != nil {
+		t.Fatalf("reopen with trailing garbage should not fail: %v", err)
+	}
+	defer reopened.Close()
+
+	if v, exists := reopened.Get("good"); !exists || v != "1" {
+		t.Errorf("expected good=1 to survive replay, got %q exists=%v", v, exists)
+	}
+}
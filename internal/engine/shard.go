@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"hash/fnv"
+	"runtime"
+	"sync"
+)
+
+// shard is one partition of a Store's keyspace: its own ordered map and
+// its own lock, so unrelated keys never contend on the same mutex.
+type shard struct {
+	mu sync.RWMutex
+	// index is this shard's position in Store.shards, fixed at creation.
+	// Code that must lock several shards together (Clear, Batch.Write,
+	// the iterators) always does so in ascending index order, so no two
+	// goroutines can ever lock the same pair of shards in opposite
+	// order.
+	index int
+	data  *skiplist[entry]
+}
+
+// newShards builds the default shard set for a new Store:
+// runtime.GOMAXPROCS(0)*4, rounded up to a power of two so fnv1a(key) &
+// (n-1) can stand in for a modulo.
+func newShards() []*shard {
+	n := nextPowerOfTwo(runtime.GOMAXPROCS(0) * 4)
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{index: i, data: newSkiplist[entry]()}
+	}
+	return shards
+}
+
+func nextPowerOfTwo(n int) int {
+	if n < 1 {
+		return 1
+	}
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// fnv1a hashes key with the 32-bit FNV-1a algorithm; it's only used to
+// pick a shard, not for anything where collision-resistance matters.
+func fnv1a(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// shardFor routes key to one of s.shards. The caller must pass the
+// fully-prefixed key, since that's what determines which shard a given
+// logical key lives in.
+func (s *Store) shardFor(key string) *shard {
+	return s.shards[fnv1a(key)&(s.numShards-1)]
+}
+
+// lockShardsAscending locks every shard for writing, in index order, so
+// that operations spanning multiple shards (Clear, Batch.Write) can't
+// deadlock against each other or against the iterators' read locks.
+func lockShardsAscending(shards []*shard) func() {
+	for _, sh := range shards {
+		sh.mu.Lock()
+	}
+	return func() {
+		for i := len(shards) - 1; i >= 0; i-- {
+			shards[i].mu.Unlock()
+		}
+	}
+}
+
+// rlockShardsAscending is the read-lock counterpart of
+// lockShardsAscending, used to take a globally consistent snapshot
+// across every shard for iteration.
+func rlockShardsAscending(shards []*shard) func() {
+	for _, sh := range shards {
+		sh.mu.RLock()
+	}
+	return func() {
+		for i := len(shards) - 1; i >= 0; i-- {
+			shards[i].mu.RUnlock()
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNextPowerOfTwo(t *testing.T) {
+	cases := map[int]int{
+		0:  1,
+		1:  1,
+		2:  2,
+		3:  4,
+		4:  4,
+		5:  8,
+		16: 16,
+		17: 32,
+	}
+	for in, want := range cases {
+		if got := nextPowerOfTwo(in); got != want {
+			t.Errorf("nextPowerOfTwo(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestShardForDistributesKeys(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	counts := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		sh := store.shardFor(key)
+		counts[sh.index]++
+	}
+
+	if len(counts) < 2 {
+		t.Errorf("expected keys to spread across multiple shards, got %d shards used", len(counts))
+	}
+}
+
+func TestShardForIsStable(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	key := "stable-key"
+	first := store.shardFor(key).index
+	for i := 0; i < 100; i++ {
+		if got := store.shardFor(key).index; got != first {
+			t.Errorf("shardFor(%q) = %d, want %d (must be stable)", key, got, first)
+		}
+	}
+}
+
+func TestKeysAcrossShards(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	want := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		store.Set(key, "v")
+		want[key] = true
+	}
+
+	got := store.Keys()
+	if len(got) != len(want) {
+		t.Fatalf("Keys() returned %d keys, want %d", len(got), len(want))
+	}
+	for _, k := range got {
+		if !want[k] {
+			t.Errorf("Keys() returned unexpected key %q", k)
+		}
+	}
+}
+
+// newStoreWithShards builds a bare store pinned to an exact shard count,
+// bypassing the runtime.GOMAXPROCS(0)*4 default, so the benchmarks below
+// can compare shard counts head to head on the same machine.
+func newStoreWithShards(n int) *Store {
+	store := newBareStore(Options{})
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{index: i, data: newSkiplist[entry]()}
+	}
+	store.shards = shards
+	store.numShards = uint32(n)
+	return store
+}
+
+func BenchmarkStoreMixedWorkload1Shard(b *testing.B) {
+	benchmarkMixedWorkload(b, 1)
+}
+
+func BenchmarkStoreMixedWorkloadNShards(b *testing.B) {
+	benchmarkMixedWorkload(b, 0) // 0 means "default shard count"
+}
+
+func benchmarkMixedWorkload(b *testing.B, shardCount int) {
+	var store *Store
+	if shardCount > 0 {
+		store = newStoreWithShards(shardCount)
+	} else {
+		store = NewStore()
+	}
+	defer store.Close()
+
+	for i := 0; i < 10000; i++ {
+		store.Set(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := fmt.Sprintf("key-%d", i%10000)
+			if i%10 == 0 {
+				store.Set(key, fmt.Sprintf("value-%d", i))
+			} else {
+				store.Get(key)
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package engine
+
+import "sync"
+
+// call represents an in-flight or completed LoadOrCompute invocation
+// for a single key.
+type call struct {
+	wg    sync.WaitGroup
+	value string
+	err   error
+}
+
+// loaderGroup deduplicates concurrent LoadOrCompute calls for the same
+// key, so a slow or expensive fn runs exactly once no matter how many
+// goroutines ask for it at the same time. This mirrors the singleflight
+// pattern and is the building block LoadOrCompute is built on. It has
+// its own mutex, separate from the shard locks, so a slow fn doesn't stall
+// unrelated reads and writes on the store.
+type loaderGroup struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+func newLoaderGroup() *loaderGroup {
+	return &loaderGroup{calls: make(map[string]*call)}
+}
+
+// LoadOrCompute returns the value stored at key if present; otherwise
+// it invokes fn, stores the result under key, and returns it. If N
+// goroutines call LoadOrCompute for the same missing key at the same
+// time, fn runs exactly once and every caller receives the same result
+// (or the same error).
+func (s *Store) LoadOrCompute(key string, fn func() (string, error)) (string, error) {
+	if v, ok := s.Get(key); ok {
+		return v, nil
+	}
+
+	fullKey := s.keyFor(key)
+	g := s.loaders
+
+	g.mu.Lock()
+	if c, inflight := g.calls[fullKey]; inflight {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.value, c.err
+	}
+	// A call for this key may have finished, and stored its value,
+	// between the Get above and taking g.mu; check again so fn doesn't
+	// run a second time.
+	if e, ok := s.getEntry(key); ok {
+		g.mu.Unlock()
+		return e.value, nil
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[fullKey] = c
+	g.mu.Unlock()
+
+	c.value, c.err = fn()
+	if c.err == nil {
+		s.Set(key, c.value)
+	}
+
+	g.mu.Lock()
+	delete(g.calls, fullKey)
+	g.mu.Unlock()
+
+	c.wg.Done()
+	return c.value, c.err
+}
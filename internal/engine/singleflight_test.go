@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadOrComputeReturnsExistingValue(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("a", "1")
+
+	called := false
+	v, err := store.LoadOrCompute("a", func() (string, error) {
+		called = true
+		return "2", nil
+	})
+	if err != nil {
+		t.Fatalf("LoadOrCompute failed: %v", err)
+	}
+	if v != "1" {
+		t.Errorf("value = %q, want 1 (fn should not run for an existing key)", v)
+	}
+	if called {
+		t.Error("fn should not be called when the key already exists")
+	}
+}
+
+func TestLoadOrComputeStoresResult(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	v, err := store.LoadOrCompute("a", func() (string, error) {
+		return "computed", nil
+	})
+	if err != nil {
+		t.Fatalf("LoadOrCompute failed: %v", err)
+	}
+	if v != "computed" {
+		t.Errorf("value = %q, want computed", v)
+	}
+
+	if stored, ok := store.Get("a"); !ok || stored != "computed" {
+		t.Errorf("Get(a) = %q, %v, want computed, true", stored, ok)
+	}
+}
+
+func TestLoadOrComputePropagatesError(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	wantErr := fmt.Errorf("boom")
+	_, err := store.LoadOrCompute("a", func() (string, error) {
+		return "", wantErr
+	})
+	if err != wantErr {
+		t.Errorf("err = %v, want %v", err, wantErr)
+	}
+	if store.Exists("a") {
+		t.Error("a failed computation should not store anything")
+	}
+}
+
+func TestLoadOrComputeCollapsesConcurrentCalls(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	var calls int32
+	var wg sync.WaitGroup
+	results := make([]string, 50)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			v, err := store.LoadOrCompute("shared", func() (string, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(10 * time.Millisecond)
+				return "value", nil
+			})
+			if err != nil {
+				t.Errorf("LoadOrCompute failed: %v", err)
+				return
+			}
+			results[idx] = v
+		}(i)
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("fn ran %d times, want exactly 1", got)
+	}
+	for i, v := range results {
+		if v != "value" {
+			t.Errorf("results[%d] = %q, want value", i, v)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package engine
+
+import "math/rand"
+
+// skiplist is an ordered, generic key/value structure keyed by string.
+// Each Store shard keeps its entries in one, so every shard's Snapshot
+// comes out already sorted; Iterator() and friends still sort the
+// merged snapshots of all shards on every call, and Keys() returns them
+// unsorted. It is not safe for concurrent use on its own; callers are
+// expected to hold the owning shard's mu.
+type skiplist[V any] struct {
+	head   *skipNode[V]
+	level  int
+	length int
+}
+
+type skipNode[V any] struct {
+	key   string
+	value V
+	next  []*skipNode[V]
+}
+
+const (
+	skiplistMaxLevel = 32
+	skiplistP        = 0.25
+)
+
+func newSkiplist[V any]() *skiplist[V] {
+	return &skiplist[V]{
+		head:  &skipNode[V]{next: make([]*skipNode[V], skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+func randomLevel() int {
+	lvl := 1
+	for lvl < skiplistMaxLevel && rand.Float64() < skiplistP {
+		lvl++
+	}
+	return lvl
+}
+
+// Set inserts key/value, or overwrites the value if key is already
+// present. It reports whether the key was newly inserted.
+func (sl *skiplist[V]) Set(key string, value V) bool {
+	update := make([]*skipNode[V], skiplistMaxLevel)
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	x = x.next[0]
+	if x != nil && x.key == key {
+		x.value = value
+		return false
+	}
+
+	lvl := randomLevel()
+	if lvl > sl.level {
+		for i := sl.level; i < lvl; i++ {
+			update[i] = sl.head
+		}
+		sl.level = lvl
+	}
+
+	node := &skipNode[V]{key: key, value: value, next: make([]*skipNode[V], lvl)}
+	for i := 0; i < lvl; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	sl.length++
+	return true
+}
+
+// Get returns the value stored at key, if any.
+func (sl *skiplist[V]) Get(key string) (V, bool) {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+	}
+	x = x.next[0]
+	if x != nil && x.key == key {
+		return x.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Delete removes key, reporting whether it was present.
+func (sl *skiplist[V]) Delete(key string) bool {
+	update := make([]*skipNode[V], skiplistMaxLevel)
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	x = x.next[0]
+	if x == nil || x.key != key {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].next[i] != x {
+			break
+		}
+		update[i].next[i] = x.next[i]
+	}
+	for sl.level > 1 && sl.head.next[sl.level-1] == nil {
+		sl.level--
+	}
+	sl.length--
+	return true
+}
+
+// Len returns the number of entries in the skiplist.
+func (sl *skiplist[V]) Len() int {
+	return sl.length
+}
+
+// Clear empties the skiplist.
+func (sl *skiplist[V]) Clear() {
+	sl.head = &skipNode[V]{next: make([]*skipNode[V], skiplistMaxLevel)}
+	sl.level = 1
+	sl.length = 0
+}
+
+// Each calls fn for every key/value pair in ascending key order,
+// stopping early if fn returns false. Unlike Snapshot, it doesn't
+// allocate a copy of the keyspace, so it's the right tool for a
+// one-off walk such as reservoir sampling.
+func (sl *skiplist[V]) Each(fn func(key string, value V) bool) {
+	for x := sl.head.next[0]; x != nil; x = x.next[0] {
+		if !fn(x.key, x.value) {
+			return
+		}
+	}
+}
+
+// Snapshot returns every key/value pair in ascending key order. It's the
+// building block for Keys() and for Store's iterators, which need a
+// point-in-time view they can walk without holding the store lock.
+func (sl *skiplist[V]) Snapshot() ([]string, []V) {
+	keys := make([]string, 0, sl.length)
+	values := make([]V, 0, sl.length)
+	for x := sl.head.next[0]; x != nil; x = x.next[0] {
+		keys = append(keys, x.key)
+		values = append(values, x.value)
+	}
+	return keys, values
+}
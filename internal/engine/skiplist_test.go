@@ -0,0 +1,66 @@
+package engine
+
+import "testing"
+
+func TestSkiplistSetGetDelete(t *testing.T) {
+	sl := newSkiplist[string]()
+
+	if _, ok := sl.Get("a"); ok {
+		t.Error("empty skiplist should not contain 'a'")
+	}
+
+	if isNew := sl.Set("a", "1"); !isNew {
+		t.Error("first Set of 'a' should report isNew=true")
+	}
+	if isNew := sl.Set("a", "2"); isNew {
+		t.Error("overwriting 'a' should report isNew=false")
+	}
+
+	v, ok := sl.Get("a")
+	if !ok || v != "2" {
+		t.Errorf("Get(a) = %q, %v, want 2, true", v, ok)
+	}
+
+	if !sl.Delete("a") {
+		t.Error("Delete(a) should return true")
+	}
+	if sl.Delete("a") {
+		t.Error("second Delete(a) should return false")
+	}
+}
+
+func TestSkiplistOrderedSnapshot(t *testing.T) {
+	sl := newSkiplist[string]()
+	for _, k := range []string{"banana", "apple", "cherry", "date"} {
+		sl.Set(k, k)
+	}
+
+	keys, values := sl.Snapshot()
+	want := []string{"apple", "banana", "cherry", "date"}
+	if !equalStrings(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	for i, k := range keys {
+		if values[i] != k {
+			t.Errorf("values[%d] = %q, want %q", i, values[i], k)
+		}
+	}
+}
+
+func TestSkiplistLenAndClear(t *testing.T) {
+	sl := newSkiplist[int]()
+	for i := 0; i < 50; i++ {
+		sl.Set(string(rune('a'+i%26))+string(rune(i)), i)
+	}
+	if sl.Len() != 50 {
+		t.Errorf("Len() = %d, want 50", sl.Len())
+	}
+
+	sl.Clear()
+	if sl.Len() != 0 {
+		t.Errorf("Len() after Clear = %d, want 0", sl.Len())
+	}
+	if _, ok := sl.Get("a"); ok {
+		t.Error("skiplist should be empty after Clear")
+	}
+}
@@ -2,89 +2,436 @@ package engine
 
 import (
 	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 )
 
-// Store represents an in-memory key-value store with thread-safe operations
+// Store represents a sharded, thread-safe key-value store. Keys are
+// routed to one of several independent shards (see shard.go), so
+// unrelated keys don't contend on a single lock; the public API below
+// is unchanged from the single-shard version, except that Keys() is no
+// longer ordered (use Iterator for that).
 type Store struct {
-	data map[string]string
-	mu   sync.RWMutex
+	shards    []*shard
+	numShards uint32
+
+	// prefix is non-empty for stores returned by PrefixStore. It is
+	// transparently prepended to every key before touching data, and
+	// stripped back off before returning keys to the caller, so callers
+	// of a prefixed Store see an unprefixed keyspace.
+	prefix string
+
+	// Durability fields, populated only when the store is opened via
+	// NewPersistentStore. persistent is checked before touching any of
+	// them so a plain NewStore pays no overhead. A PrefixStore shares
+	// persistent, dir, opts, wal and walMu with the store it was derived
+	// from, but has its own walSize and checkpointing: each Store counts
+	// only the WAL bytes written through it toward CheckpointBytes, and
+	// a Checkpoint resets only the walSize of the Store it was called
+	// on. walMu guards the WAL
+	// file itself, independently of the per-shard locks, since the WAL
+	// is one append-only log shared by every shard.
+	persistent    bool
+	dir           string
+	opts          Options
+	wal           *os.File
+	walMu         *sync.Mutex
+	walSize       int64
+	checkpointing int32
+
+	// stopSweep signals the active-expiration goroutine to exit; it is
+	// only set on the store returned directly by NewStore/
+	// NewPersistentStore. A PrefixStore shares its parent's shards and
+	// relies on the parent's sweeper, so it leaves this nil.
+	stopSweep chan struct{}
+	closeOnce sync.Once
+
+	// loaders deduplicates concurrent LoadOrCompute calls. It is shared
+	// with any PrefixStore derived from s, since they share the same
+	// backing data.
+	loaders *loaderGroup
+
+	// Eviction bookkeeping, active only when opts.Policy is non-nil.
+	// policyMu guards opts.Policy, since a single policy instance tracks
+	// access order across every shard and so can't be covered by any one
+	// shard's lock. entryCount/hits/misses/evictions are pointers so a
+	// PrefixStore shares the same counters as the store it was derived
+	// from, the same way walMu and loaders are shared.
+	policyMu   *sync.Mutex
+	entryCount *int64
+	hits       *int64
+	misses     *int64
+	evictions  *int64
+}
+
+// newBareStore allocates a Store's shards and bookkeeping fields without
+// starting its background sweeper goroutine, so that
+// NewPersistentStore can finish loading from disk before the sweeper
+// might touch the data.
+func newBareStore(opts Options) *Store {
+	shards := newShards()
+	return &Store{
+		shards:     shards,
+		numShards:  uint32(len(shards)),
+		opts:       opts,
+		walMu:      &sync.Mutex{},
+		stopSweep:  make(chan struct{}),
+		loaders:    newLoaderGroup(),
+		policyMu:   &sync.Mutex{},
+		entryCount: new(int64),
+		hits:       new(int64),
+		misses:     new(int64),
+		evictions:  new(int64),
+	}
 }
 
-// NewStore creates a new Store instance
+// NewStore creates a new Store instance.
 func NewStore() *Store {
+	return NewStoreWithOptions(Options{})
+}
+
+// NewStoreWithOptions creates a new Store configured by opts. Only
+// MaxEntries and Policy are meaningful here; the WAL-related fields are
+// ignored (use NewPersistentStore for a durable store). Eviction is
+// disabled unless both MaxEntries > 0 and Policy are set.
+func NewStoreWithOptions(opts Options) *Store {
+	s := newBareStore(opts)
+	go s.runTTLSweeper()
+	return s
+}
+
+// PrefixStore returns a Store that transparently namespaces every key
+// under prefix, while sharing the same backing shards and WAL as s.
+// It's useful for carving multiple logical stores out of one backend,
+// e.g. one per tenant or subsystem, without the overhead of a separate
+// Store.
+func (s *Store) PrefixStore(prefix string) *Store {
 	return &Store{
-		data: make(map[string]string),
+		shards:     s.shards,
+		numShards:  s.numShards,
+		prefix:     s.prefix + prefix,
+		persistent: s.persistent,
+		dir:        s.dir,
+		opts:       s.opts,
+		wal:        s.wal,
+		walMu:      s.walMu,
+		loaders:    s.loaders,
+		policyMu:   s.policyMu,
+		entryCount: s.entryCount,
+		hits:       s.hits,
+		misses:     s.misses,
+		evictions:  s.evictions,
 	}
 }
 
-// Set stores a key-value pair in the store
+func (s *Store) keyFor(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + key
+}
+
+// Set stores a key-value pair in the store, clearing any TTL previously
+// set on key via SetWithTTL. If the store has an eviction policy
+// configured and is at capacity, inserting a new key evicts one or more
+// existing keys first, per the policy's Evict().
 func (s *Store) Set(key, value string) error {
 	if key == "" {
 		return fmt.Errorf("key cannot be empty")
 	}
-	
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
-	s.data[key] = value
+
+	fullKey := s.keyFor(key)
+	sh := s.shardFor(fullKey)
+
+	// This pre-check is only an admission heuristic to decide whether to
+	// make room before writing; evictForInsert can't run under sh.mu
+	// below, since it may need to evict a key from this very shard and
+	// sync.RWMutex isn't reentrant. The authoritative answer for
+	// bookkeeping comes from sh.data.Set's return value once we're
+	// actually inside the write lock, so two concurrent Sets of the same
+	// brand-new key can't both believe they inserted it.
+	sh.mu.RLock()
+	_, maybeExisted := sh.data.Get(fullKey)
+	sh.mu.RUnlock()
+	if !maybeExisted {
+		s.evictForInsert()
+	}
+
+	sh.mu.Lock()
+	err := s.appendWAL(opSet, fullKey, value)
+	var existed bool
+	if err == nil {
+		existed = !sh.data.Set(fullKey, entry{value: value})
+	}
+	sh.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.recordSet(fullKey, existed)
+	s.maybeCheckpoint()
 	return nil
 }
 
-// Get retrieves a value by key from the store
+// recordSet tells the eviction policy, if any, about a Set that just
+// completed: a fresh insert if existed is false, otherwise a touch of
+// an already-present key.
+func (s *Store) recordSet(fullKey string, existed bool) {
+	if s.opts.Policy == nil {
+		return
+	}
+	s.policyMu.Lock()
+	if existed {
+		s.opts.Policy.RecordAccess(fullKey)
+	} else {
+		s.opts.Policy.RecordInsert(fullKey)
+	}
+	s.policyMu.Unlock()
+	if !existed {
+		atomic.AddInt64(s.entryCount, 1)
+	}
+}
+
+// Get retrieves a value by key from the store. A key whose TTL has
+// elapsed is treated as absent and lazily removed. A hit or miss here
+// is reflected in HitRate, and a hit also counts as an access for the
+// eviction policy, if one is configured.
 func (s *Store) Get(key string) (string, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
-	value, exists := s.data[key]
-	return value, exists
+	e, ok := s.getEntry(key)
+	if !ok {
+		atomic.AddInt64(s.misses, 1)
+		return "", false
+	}
+	atomic.AddInt64(s.hits, 1)
+	s.recordAccess(s.keyFor(key))
+	return e.value, true
+}
+
+func (s *Store) recordAccess(fullKey string) {
+	if s.opts.Policy == nil {
+		return
+	}
+	s.policyMu.Lock()
+	s.opts.Policy.RecordAccess(fullKey)
+	s.policyMu.Unlock()
 }
 
-// Delete removes a key-value pair from the store
+// evictForInsert evicts keys, via the configured policy, until the
+// store has room for one more entry. It is a no-op unless both
+// opts.MaxEntries and opts.Policy are set.
+func (s *Store) evictForInsert() {
+	if s.opts.Policy == nil || s.opts.MaxEntries <= 0 {
+		return
+	}
+	for atomic.LoadInt64(s.entryCount) >= int64(s.opts.MaxEntries) {
+		s.policyMu.Lock()
+		key, ok := s.opts.Policy.Evict()
+		s.policyMu.Unlock()
+		if !ok {
+			return
+		}
+		if s.deleteShardEntry(key) {
+			atomic.AddInt64(s.entryCount, -1)
+			atomic.AddInt64(s.evictions, 1)
+		}
+	}
+}
+
+// deleteShardEntry removes fullKey from its shard and WAL, without
+// touching the eviction policy (the caller is responsible for that,
+// since callers either already removed fullKey from the policy
+// themselves, as evictForInsert does via Evict, or want to keep it).
+func (s *Store) deleteShardEntry(fullKey string) bool {
+	sh := s.shardFor(fullKey)
+	sh.mu.Lock()
+	_, existed := sh.data.Get(fullKey)
+	if existed {
+		s.appendWAL(opDelete, fullKey, "")
+		sh.data.Delete(fullKey)
+	}
+	sh.mu.Unlock()
+	return existed
+}
+
+// getEntry looks up key, applying lazy TTL expiration: an expired entry
+// is deleted and reported as not found.
+func (s *Store) getEntry(key string) (entry, bool) {
+	fullKey := s.keyFor(key)
+	sh := s.shardFor(fullKey)
+
+	sh.mu.RLock()
+	e, ok := sh.data.Get(fullKey)
+	sh.mu.RUnlock()
+	if !ok || !e.expired() {
+		return e, ok
+	}
+
+	sh.mu.Lock()
+	expiredNow := false
+	if e, ok := sh.data.Get(fullKey); ok && e.expired() {
+		s.appendWAL(opDelete, fullKey, "")
+		sh.data.Delete(fullKey)
+		expiredNow = true
+	}
+	sh.mu.Unlock()
+	if expiredNow {
+		s.recordDelete(fullKey)
+		s.maybeCheckpoint()
+	}
+	return entry{}, false
+}
+
+// recordDelete tells the eviction policy, if any, that fullKey is gone,
+// and adjusts entryCount to match.
+func (s *Store) recordDelete(fullKey string) {
+	if s.opts.Policy == nil {
+		return
+	}
+	s.policyMu.Lock()
+	s.opts.Policy.RecordDelete(fullKey)
+	s.policyMu.Unlock()
+	atomic.AddInt64(s.entryCount, -1)
+}
+
+// Delete removes a key-value pair from the store. It reports false for
+// a key whose TTL has already elapsed, since it is logically absent.
 func (s *Store) Delete(key string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
-	_, exists := s.data[key]
-	if exists {
-		delete(s.data, key)
+	fullKey := s.keyFor(key)
+	sh := s.shardFor(fullKey)
+
+	sh.mu.Lock()
+	e, exists := sh.data.Get(fullKey)
+	if !exists {
+		sh.mu.Unlock()
+		return false
+	}
+	err := s.appendWAL(opDelete, fullKey, "")
+	if err == nil {
+		sh.data.Delete(fullKey)
 	}
-	return exists
+	sh.mu.Unlock()
+	if err != nil {
+		return false
+	}
+
+	s.recordDelete(fullKey)
+	s.maybeCheckpoint()
+	return !e.expired()
 }
 
-// Exists checks if a key exists in the store
+// Exists checks if a key exists in the store and has not expired. A hit
+// also counts as an access for the eviction policy, if one is
+// configured, same as Get.
 func (s *Store) Exists(key string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
-	_, exists := s.data[key]
-	return exists
+	_, ok := s.getEntry(key)
+	if ok {
+		s.recordAccess(s.keyFor(key))
+	}
+	return ok
 }
 
-// Keys returns all keys in the store
+// Keys returns every non-expired key in the store. Because the store is
+// sharded, keys are gathered shard by shard and the result is NOT
+// sorted; use Iterator, ReverseIterator or PrefixScan for ordered
+// traversal.
 func (s *Store) Keys() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
-	keys := make([]string, 0, len(s.data))
-	for k := range s.data {
-		keys = append(keys, k)
+	var keys []string
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		ks, vs := sh.data.Snapshot()
+		for i, k := range ks {
+			if !vs[i].expired() {
+				keys = append(keys, k)
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return s.unprefixed(keys)
+}
+
+// unprefixed filters a key list down to keys under s.prefix and strips
+// the prefix back off. For the root store (prefix == "") it returns
+// keys unchanged.
+func (s *Store) unprefixed(keys []string) []string {
+	if s.prefix == "" {
+		return keys
+	}
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if trimmed, ok := cutPrefix(k, s.prefix); ok {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || s[:len(prefix)] != prefix {
+		return "", false
 	}
-	return keys
+	return s[len(prefix):], true
 }
 
-// Clear removes all key-value pairs from the store
+// Clear removes all key-value pairs from the store. For a PrefixStore
+// this only clears keys under its own prefix, leaving the rest of the
+// shared backend untouched. Every shard is locked, in a fixed ascending
+// order, for the duration of the clear.
 func (s *Store) Clear() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
-	s.data = make(map[string]string)
+	unlock := lockShardsAscending(s.shards)
+
+	var clearedKeys []string
+	if s.prefix == "" {
+		s.appendWAL(opClear, "", "")
+		for _, sh := range s.shards {
+			if s.opts.Policy != nil {
+				keys, _ := sh.data.Snapshot()
+				clearedKeys = append(clearedKeys, keys...)
+			}
+			sh.data.Clear()
+		}
+	} else {
+		for _, sh := range s.shards {
+			keys, _ := sh.data.Snapshot()
+			for _, k := range keys {
+				if _, ok := cutPrefix(k, s.prefix); ok {
+					s.appendWAL(opDelete, k, "")
+					sh.data.Delete(k)
+					clearedKeys = append(clearedKeys, k)
+				}
+			}
+		}
+	}
+	unlock()
+
+	if s.opts.Policy != nil && len(clearedKeys) > 0 {
+		s.policyMu.Lock()
+		for _, k := range clearedKeys {
+			s.opts.Policy.RecordDelete(k)
+		}
+		s.policyMu.Unlock()
+		atomic.AddInt64(s.entryCount, -int64(len(clearedKeys)))
+	}
+	s.maybeCheckpoint()
 }
 
-// Size returns the number of key-value pairs in the store
+// Size returns the number of non-expired key-value pairs in the store.
 func (s *Store) Size() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
-	return len(s.data)
-}
\ No newline at end of file
+	count := 0
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		keys, values := sh.data.Snapshot()
+		for i, k := range keys {
+			if s.prefix != "" {
+				if _, ok := cutPrefix(k, s.prefix); !ok {
+					continue
+				}
+			}
+			if !values[i].expired() {
+				count++
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return count
+}
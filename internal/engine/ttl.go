@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// entry is the value type stored in Store's skiplist. expiresAt is the
+// zero time.Time for keys set via Set, meaning "no TTL".
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (e entry) expired() bool {
+	return !e.expiresAt.IsZero() && time.Now().After(e.expiresAt)
+}
+
+const (
+	// ttlSweepInterval is how often the active expiration goroutine
+	// samples the store for expired keys.
+	ttlSweepInterval = 1 * time.Second
+	// ttlSweepSampleSize is how many keys are sampled per sweep.
+	ttlSweepSampleSize = 20
+	// ttlSweepRepeatThreshold is the fraction of a sample that must be
+	// expired for the sweeper to immediately take another sample,
+	// mirroring Redis's active expiration cycle.
+	ttlSweepRepeatThreshold = 0.25
+)
+
+// SetWithTTL stores a key-value pair that expires after ttl. A ttl of
+// zero or less means the key never expires, same as Set. Reads
+// (Get/Exists) lazily drop an expired key the moment they see it; a
+// background sweeper also samples the store periodically so idle,
+// never-read keys don't linger forever.
+//
+// The expiry is not part of the WAL/snapshot format, so a persistent
+// store that is restarted loses TTLs on any keys it had set.
+func (s *Store) SetWithTTL(key, value string, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key cannot be empty")
+	}
+
+	fullKey := s.keyFor(key)
+	sh := s.shardFor(fullKey)
+
+	e := entry{value: value}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+
+	// See Set in store.go for why this existence check is only an
+	// eviction-admission heuristic, not the value used for bookkeeping.
+	sh.mu.RLock()
+	_, maybeExisted := sh.data.Get(fullKey)
+	sh.mu.RUnlock()
+	if !maybeExisted {
+		s.evictForInsert()
+	}
+
+	sh.mu.Lock()
+	err := s.appendWAL(opSet, fullKey, value)
+	var existed bool
+	if err == nil {
+		existed = !sh.data.Set(fullKey, e)
+	}
+	sh.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.recordSet(fullKey, existed)
+	s.maybeCheckpoint()
+	return nil
+}
+
+// TTL reports the remaining time until key expires, and whether key is
+// currently present in the store. A zero duration with ok=true means
+// key exists but has no TTL set.
+func (s *Store) TTL(key string) (time.Duration, bool) {
+	e, ok := s.getEntry(key)
+	if !ok {
+		return 0, false
+	}
+	if e.expiresAt.IsZero() {
+		return 0, true
+	}
+	remaining := time.Until(e.expiresAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// runTTLSweeper is the active-expiration loop started by NewStore. It
+// exits once stopSweep is closed by Close().
+func (s *Store) runTTLSweeper() {
+	ticker := time.NewTicker(ttlSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopSweep:
+			return
+		case <-ticker.C:
+			s.sweepExpired()
+		}
+	}
+}
+
+// keyShard pairs a key with the shard it lives in, so sweepExpired can
+// sample across every shard's keyspace without holding all the shards'
+// locks at once.
+type keyShard struct {
+	key string
+	sh  *shard
+}
+
+// sweepExpired samples up to ttlSweepSampleSize random keys and deletes
+// any that have expired. If more than ttlSweepRepeatThreshold of the
+// sample was expired, it immediately samples again, so a burst of
+// expirations is cleared in one tick rather than trickling out.
+func (s *Store) sweepExpired() {
+	for {
+		sample := s.sampleKeys(ttlSweepSampleSize)
+		if len(sample) == 0 {
+			return
+		}
+
+		expired := 0
+		for _, ks := range sample {
+			// Most sampled keys won't have expired, so check under an
+			// RLock first and only pay for the write lock - and the
+			// blocking of readers/writers of this shard that comes with
+			// it - on the ones that actually need deleting.
+			ks.sh.mu.RLock()
+			e, ok := ks.sh.data.Get(ks.key)
+			isExpired := ok && e.expired()
+			ks.sh.mu.RUnlock()
+			if !isExpired {
+				continue
+			}
+
+			ks.sh.mu.Lock()
+			wasExpired := false
+			if e, ok := ks.sh.data.Get(ks.key); ok && e.expired() {
+				s.appendWAL(opDelete, ks.key, "")
+				ks.sh.data.Delete(ks.key)
+				wasExpired = true
+			}
+			ks.sh.mu.Unlock()
+			if wasExpired {
+				s.recordDelete(ks.key)
+				expired++
+			}
+		}
+		if expired > 0 {
+			s.maybeCheckpoint()
+		}
+
+		if float64(expired)/float64(len(sample)) <= ttlSweepRepeatThreshold {
+			return
+		}
+	}
+}
+
+// sampleKeys returns up to n keys chosen uniformly at random from
+// across every shard, using reservoir sampling as it walks each shard
+// once. Unlike snapshotting every key and permuting the whole list,
+// this costs O(n) space rather than O(store size), which matters for a
+// sweep that runs once a second for the life of the store.
+func (s *Store) sampleKeys(n int) []keyShard {
+	reservoir := make([]keyShard, 0, n)
+	seen := 0
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		sh.data.Each(func(key string, _ entry) bool {
+			seen++
+			if len(reservoir) < n {
+				reservoir = append(reservoir, keyShard{key: key, sh: sh})
+			} else if j := rand.Intn(seen); j < n {
+				reservoir[j] = keyShard{key: key, sh: sh}
+			}
+			return true
+		})
+		sh.mu.RUnlock()
+	}
+	return reservoir
+}
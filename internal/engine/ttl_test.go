@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetWithTTLExpires(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SetWithTTL("a", "1", 20*time.Millisecond)
+
+	if v, ok := store.Get("a"); !ok || v != "1" {
+		t.Fatalf("Get(a) before expiry = %q, %v, want 1, true", v, ok)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	if _, ok := store.Get("a"); ok {
+		t.Error("key should be expired and absent")
+	}
+	if store.Exists("a") {
+		t.Error("Exists should report false for an expired key")
+	}
+}
+
+func TestSetWithTTLZeroMeansNoExpiry(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SetWithTTL("a", "1", 0)
+	remaining, ok := store.TTL("a")
+	if !ok {
+		t.Fatal("key should exist")
+	}
+	if remaining != 0 {
+		t.Errorf("remaining TTL = %v, want 0 (no expiry)", remaining)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := store.Get("a"); !ok {
+		t.Error("key with zero TTL should never expire")
+	}
+}
+
+func TestTTLUpdateViaReSet(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SetWithTTL("a", "1", 20*time.Millisecond)
+	store.SetWithTTL("a", "1", time.Hour)
+
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := store.Get("a"); !ok {
+		t.Error("re-Set with a longer TTL should postpone expiry")
+	}
+}
+
+func TestPlainSetClearsTTL(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SetWithTTL("a", "1", 20*time.Millisecond)
+	store.Set("a", "2")
+
+	time.Sleep(40 * time.Millisecond)
+	if v, ok := store.Get("a"); !ok || v != "2" {
+		t.Errorf("plain Set should clear the TTL, got %q, %v", v, ok)
+	}
+}
+
+func TestTTLNonExistentKey(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if _, ok := store.TTL("missing"); ok {
+		t.Error("TTL on a missing key should report ok=false")
+	}
+}
+
+func TestActiveSweeperRemovesExpiredKeys(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	for i := 0; i < 30; i++ {
+		store.SetWithTTL(string(rune('a'+i%26))+string(rune(i)), "v", 10*time.Millisecond)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	store.sweepExpired()
+
+	if got := store.Size(); got != 0 {
+		t.Errorf("expected sweeper to clear all expired keys, Size() = %d", got)
+	}
+}
+
+func TestConcurrentSweepVsReads(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	for i := 0; i < 200; i++ {
+		store.SetWithTTL(string(rune(i)), "v", 5*time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				store.Get(string(rune(j)))
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		store.sweepExpired()
+	}()
+	wg.Wait()
+}